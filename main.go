@@ -1,88 +1,172 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	"golang.org/x/image/webp"
+	"github.com/IntruderVs/macOS-converter-webp-to-png/pkg/imgconv"
 )
 
-func convertWebPToPNG(inputPath, outputPath string) error {
-	// Читаем файл полностью в память для более надежного декодирования
-	// (некоторые WebP файлы могут не работать с потоковым чтением)
-	inputData, err := os.ReadFile(inputPath)
+// conversionError описывает файл, который не удалось сконвертировать.
+type conversionError struct {
+	fileName string
+	errorMsg string
+}
+
+// conversionJob - это одна единица работы для воркера: входной файл и путь результата.
+type conversionJob struct {
+	sourceFile string
+	inputPath  string
+	outputPath string
+	outName    string
+}
+
+// conversionResult - результат обработки одного conversionJob воркером.
+type conversionResult struct {
+	job   conversionJob
+	bytes int64 // размер входного файла, для подсчета пропускной способности
+	err   error
+}
+
+// stdoutIsTTY сообщает, подключен ли stdout к терминалу (а не к файлу/пайпу).
+func stdoutIsTTY() bool {
+	info, err := os.Stdout.Stat()
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл: %w", err)
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
 
-	// Пытаемся декодировать изображение - сначала как WebP, затем как JPEG
-	// (некоторые файлы с расширением .webp на самом деле являются JPEG)
-	var img image.Image
+// WalkOptions управляет обходом входной директории: рекурсию, фильтрацию по glob-маскам
+// и поведение при повторном запуске на частично сконвертированном дереве.
+type WalkOptions struct {
+	Recursive    bool
+	Include      string // glob относительно inputDir, например "**/*.webp"
+	Exclude      string // glob относительно inputDir, например "node_modules/**"
+	SkipExisting bool   // не конвертировать, если выходной файл уже существует
+	Overwrite    bool   // всегда перезаписывать выходной файл (поведение по умолчанию)
+}
 
-	// Пробуем декодировать как WebP
-	img, err = webp.Decode(bytes.NewReader(inputData))
-	if err != nil {
-		// Если не получилось, пробуем декодировать как JPEG
-		img, err = jpeg.Decode(bytes.NewReader(inputData))
-		if err != nil {
-			return fmt.Errorf("не удалось декодировать изображение (пробовались форматы WebP и JPEG): %w", err)
+// isConvertibleExt сообщает, стоит ли вообще пытаться конвертировать файл с таким именем.
+// Без явного -format целевой формат определяется автоматически только для webp -> png,
+// поэтому без -format в выборку попадают только .webp - иначе каждый .png/.jpg, уже лежащий
+// в директории (обычный случай для папок с разнородными ассетами), считался бы ошибкой.
+func isConvertibleExt(name, format string) bool {
+	name = strings.ToLower(name)
+	if format == "" {
+		return strings.HasSuffix(name, ".webp")
+	}
+	return strings.HasSuffix(name, ".webp") || strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".jpg") || strings.HasSuffix(name, ".jpeg")
+}
+
+// globToRegexp компилирует glob-маску в регулярное выражение. Помимо `*` и `?`
+// поддерживается `**`, означающий любое количество вложенных директорий.
+func globToRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 3
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i += 2
+		case pattern[i] == '*':
+			sb.WriteString("[^/]*")
+			i++
+		case pattern[i] == '?':
+			sb.WriteString("[^/]")
+			i++
+		case strings.ContainsRune(`.+()|[]{}^$\`, rune(pattern[i])):
+			sb.WriteString("\\" + string(pattern[i]))
+			i++
+		default:
+			sb.WriteByte(pattern[i])
+			i++
 		}
 	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
 
-	// Создаем выходной файл только после успешного декодирования
-	outputFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("не удалось создать выходной файл: %w", err)
+// matchesFilters проверяет относительный путь (со слешами) на соответствие -include и -exclude.
+func matchesFilters(relPath, include, exclude string) bool {
+	if include != "" && !globToRegexp(include).MatchString(relPath) {
+		return false
+	}
+	if exclude != "" && globToRegexp(exclude).MatchString(relPath) {
+		return false
 	}
-	defer outputFile.Close()
+	return true
+}
 
-	// Кодируем в PNG
-	err = png.Encode(outputFile, img)
-	if err != nil {
-		outputFile.Close()
-		os.Remove(outputPath) // Удаляем неполный файл при ошибке
-		return fmt.Errorf("не удалось закодировать PNG: %w", err)
+// collectSourceFiles возвращает пути файлов для конвертации относительно inputDir.
+// Без -recursive обходится только верхний уровень директории, как и раньше.
+func collectSourceFiles(inputDir, format string, walkOpts WalkOptions) ([]string, error) {
+	var files []string
+
+	if !walkOpts.Recursive {
+		entries, err := os.ReadDir(inputDir)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать директорию: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isConvertibleExt(entry.Name(), format) {
+				continue
+			}
+			if matchesFilters(entry.Name(), walkOpts.Include, walkOpts.Exclude) {
+				files = append(files, entry.Name())
+			}
+		}
+		return files, nil
 	}
 
-	// Синхронизируем данные на диск
-	err = outputFile.Sync()
+	err := filepath.WalkDir(inputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isConvertibleExt(d.Name(), format) {
+			return nil
+		}
+		rel, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return err
+		}
+		if matchesFilters(filepath.ToSlash(rel), walkOpts.Include, walkOpts.Exclude) {
+			files = append(files, rel)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("не удалось синхронизировать файл: %w", err)
+		return nil, fmt.Errorf("не удалось обойти директорию: %w", err)
 	}
-
-	return nil
+	return files, nil
 }
 
-func convertDirectory(inputDir, outputDir string) error {
-	// Читаем директорию
-	entries, err := os.ReadDir(inputDir)
+// convertDirectory обходит inputDir (см. WalkOptions), распределяет найденные файлы
+// по пулу из workers воркеров через imgconv.ConvertFile и агрегирует результаты.
+func convertDirectory(inputDir, outputDir string, opts imgconv.Options, workers int, walkOpts WalkOptions) error {
+	sourceFiles, err := collectSourceFiles(inputDir, opts.Format, walkOpts)
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать директорию: %w", err)
-	}
-
-	var webpFiles []string
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			name := strings.ToLower(entry.Name())
-			if strings.HasSuffix(name, ".webp") {
-				webpFiles = append(webpFiles, entry.Name())
-			}
-		}
+		return err
 	}
 
-	if len(webpFiles) == 0 {
-		fmt.Printf("WebP файлы не найдены в директории: %s\n", inputDir)
+	if len(sourceFiles) == 0 {
+		fmt.Printf("Файлы для конвертации не найдены в директории: %s\n", inputDir)
 		return nil
 	}
 
-	fmt.Printf("Найдено WebP файлов: %d\n", len(webpFiles))
+	fmt.Printf("Найдено файлов: %d\n", len(sourceFiles))
 
 	// Создаем выходную директорию, если нужно
 	if outputDir != "" && outputDir != inputDir {
@@ -92,53 +176,113 @@ func convertDirectory(inputDir, outputDir string) error {
 		}
 	}
 
-	// Слайс для хранения ошибок конвертации
-	type conversionError struct {
-		fileName string
-		errorMsg string
+	if workers < 1 {
+		workers = 1
 	}
-	var errors []conversionError
 
-	successCount := 0
-	for _, webpFile := range webpFiles {
-		inputPath := filepath.Join(inputDir, webpFile)
-		pngName := strings.TrimSuffix(webpFile, filepath.Ext(webpFile)) + ".png"
+	// Формируем список заданий заранее, чтобы воркеры могли просто брать их из канала
+	jobs := make(chan conversionJob, len(sourceFiles))
+	skippedCount := 0
+	for _, sourceFile := range sourceFiles {
+		inputPath := filepath.Join(inputDir, sourceFile)
+		relDir := filepath.Dir(sourceFile)
 
-		var outputPath string
-		if outputDir != "" {
-			outputPath = filepath.Join(outputDir, pngName)
-		} else {
-			outputPath = filepath.Join(inputDir, pngName)
-		}
-
-		err := convertWebPToPNG(inputPath, outputPath)
+		ext, err := imgconv.TargetExt(inputPath, opts.Format)
 		if err != nil {
-			errorMsg := fmt.Sprintf("Ошибка при конвертации %s: %v", webpFile, err)
-			fmt.Fprintf(os.Stderr, "%s\n", errorMsg)
-			errors = append(errors, conversionError{fileName: webpFile, errorMsg: errorMsg})
+			jobs <- conversionJob{sourceFile: sourceFile, inputPath: inputPath}
 			continue
 		}
+		outName := strings.TrimSuffix(filepath.Base(sourceFile), filepath.Ext(sourceFile)) + ext
 
-		// Проверяем, что выходной файл действительно создан и не пустой
-		outputInfo, err := os.Stat(outputPath)
-		if err != nil {
-			errorMsg := fmt.Sprintf("Выходной файл %s не найден после конвертации %s", outputPath, webpFile)
-			fmt.Fprintf(os.Stderr, "Ошибка: %s\n", errorMsg)
-			errors = append(errors, conversionError{fileName: webpFile, errorMsg: errorMsg})
-			continue
+		// Зеркалим относительную поддиректорию входного файла под outputDir
+		baseDir := outputDir
+		if baseDir == "" {
+			baseDir = inputDir
 		}
-		if outputInfo.Size() == 0 {
-			errorMsg := fmt.Sprintf("Выходной файл %s пустой после конвертации %s", outputPath, webpFile)
-			fmt.Fprintf(os.Stderr, "Ошибка: %s\n", errorMsg)
-			os.Remove(outputPath) // Удаляем пустой файл
-			errors = append(errors, conversionError{fileName: webpFile, errorMsg: errorMsg})
-			continue
+		outputPath := filepath.Join(baseDir, relDir, outName)
+
+		if walkOpts.SkipExisting && !walkOpts.Overwrite {
+			if info, statErr := os.Stat(outputPath); statErr == nil && info.Size() > 0 {
+				skippedCount++
+				continue
+			}
+		}
+
+		if relDir != "." {
+			if err := os.MkdirAll(filepath.Join(baseDir, relDir), 0755); err != nil {
+				jobs <- conversionJob{sourceFile: sourceFile, inputPath: inputPath}
+				continue
+			}
+		}
+
+		jobs <- conversionJob{sourceFile: sourceFile, inputPath: inputPath, outputPath: outputPath, outName: outName}
+	}
+	close(jobs)
+
+	results := make(chan conversionResult, len(sourceFiles))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- processConversionJob(job, opts)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var errors []conversionError
+	successCount := 0
+	processed := 0
+	var bytesProcessed int64
+	showProgress := stdoutIsTTY()
+	startTime := time.Now()
+
+	for result := range results {
+		processed++
+		bytesProcessed += result.bytes
+
+		if result.err != nil {
+			errorMsg := result.err.Error()
+			errors = append(errors, conversionError{fileName: result.job.sourceFile, errorMsg: errorMsg})
+		} else {
+			successCount++
 		}
 
-		fmt.Printf("✓ Конвертировано: %s -> %s\n", webpFile, pngName)
-		successCount++
+		if showProgress {
+			elapsed := time.Since(startTime).Seconds()
+			throughput := 0.0
+			if elapsed > 0 {
+				throughput = float64(bytesProcessed) / 1024 / 1024 / elapsed
+			}
+			eta := time.Duration(0)
+			if processed > 0 && elapsed > 0 {
+				perFile := elapsed / float64(processed)
+				eta = time.Duration(perFile*float64(len(sourceFiles)-skippedCount-processed)) * time.Second
+			}
+			fmt.Printf("\rОбработано: %d/%d, %.2f МБ/с, осталось ~%s        ", processed, len(sourceFiles)-skippedCount, throughput, eta.Round(time.Second))
+		} else if result.err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка при конвертации %s: %s\n", result.job.sourceFile, result.err)
+		} else {
+			fmt.Printf("✓ Конвертировано: %s -> %s\n", result.job.sourceFile, result.job.outName)
+		}
+	}
+
+	if showProgress {
+		fmt.Println()
 	}
 
+	// Сортируем ошибки по имени файла, чтобы отчет был детерминированным
+	sort.Slice(errors, func(i, j int) bool {
+		return errors[i].fileName < errors[j].fileName
+	})
+
 	// Создаем файл отчета с ошибками, если есть ошибки
 	if len(errors) > 0 {
 		reportDir := outputDir
@@ -166,22 +310,79 @@ func convertDirectory(inputDir, outputDir string) error {
 		}
 	}
 
-	fmt.Printf("\nКонвертация завершена. Успешно: %d из %d\n", successCount, len(webpFiles))
+	if skippedCount > 0 {
+		fmt.Printf("Пропущено (уже сконвертировано): %d\n", skippedCount)
+	}
+	fmt.Printf("\nКонвертация завершена. Успешно: %d из %d\n", successCount, len(sourceFiles)-skippedCount)
 	return nil
 }
 
+// processConversionJob выполняет одно задание конвертации и проверяет результат.
+// Выполняется параллельно из нескольких воркеров convertDirectory, поэтому не должна
+// обращаться к разделяемому состоянию, кроме как через возвращаемое значение.
+func processConversionJob(job conversionJob, opts imgconv.Options) conversionResult {
+	inputInfo, statErr := os.Stat(job.inputPath)
+	var inputSize int64
+	if statErr == nil {
+		inputSize = inputInfo.Size()
+	}
+
+	if job.outputPath == "" {
+		return conversionResult{job: job, bytes: inputSize, err: fmt.Errorf("не удалось определить целевой формат для %s (укажите -format webp|png)", job.sourceFile)}
+	}
+
+	if err := imgconv.ConvertFile(job.inputPath, job.outputPath, opts); err != nil {
+		return conversionResult{job: job, bytes: inputSize, err: fmt.Errorf("ошибка при конвертации %s: %w", job.sourceFile, err)}
+	}
+
+	// Проверяем, что выходной файл действительно создан и не пустой
+	outputInfo, err := os.Stat(job.outputPath)
+	if err != nil {
+		return conversionResult{job: job, bytes: inputSize, err: fmt.Errorf("выходной файл %s не найден после конвертации %s", job.outputPath, job.sourceFile)}
+	}
+	if outputInfo.Size() == 0 {
+		os.Remove(job.outputPath) // Удаляем пустой файл
+		return conversionResult{job: job, bytes: inputSize, err: fmt.Errorf("выходной файл %s пустой после конвертации %s", job.outputPath, job.sourceFile)}
+	}
+
+	return conversionResult{job: job, bytes: inputSize}
+}
+
 func main() {
+	format := flag.String("format", "", "целевой формат конвертации: webp или png (по умолчанию определяется автоматически для webp -> png)")
+	method := flag.Int("method", 4, "компромисс скорость/сжатие при кодировании WebP (всегда без потерь, VP8L), 0-6 (только при конвертации в webp)")
+	workers := flag.Int("workers", runtime.NumCPU(), "количество воркеров для параллельной конвертации директории")
+	recursive := flag.Bool("recursive", false, "обходить вложенные директории")
+	include := flag.String("include", "", "конвертировать только файлы, совпадающие с glob-маской (например '**/*.webp')")
+	exclude := flag.String("exclude", "", "пропускать файлы, совпадающие с glob-маской (например 'node_modules/**')")
+	skipExisting := flag.Bool("skip-existing", false, "не конвертировать файл, если выходной файл уже существует")
+	overwrite := flag.Bool("overwrite", false, "всегда перезаписывать существующий выходной файл")
+	width := flag.Int("width", 0, "изменить ширину изображения (0 - сохранить пропорции по height)")
+	height := flag.Int("height", 0, "изменить высоту изображения (0 - сохранить пропорции по width)")
+	maxDim := flag.Int("max-dim", 0, "ограничить большую сторону изображения этим значением")
+	fit := flag.String("fit", "contain", "режим вписывания при заданных width и height: contain, cover или stretch")
+	thumbnails := flag.String("thumbnails", "", "список размеров миниатюр через запятую, например '32,128,512'")
+	animated := flag.String("animated", imgconv.AnimatedFirstFrame, "как обрабатывать анимированный WebP: "+imgconv.AnimatedPNG+", "+imgconv.AnimatedGIF+" или "+imgconv.AnimatedFirstFrame)
+	preserveMetadata := flag.Bool("preserve-metadata", true, "переносить EXIF/XMP/ICC метаданные из WebP в выходной PNG")
+
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "WebP to PNG Converter\n")
+		fmt.Fprintf(os.Stderr, "imgconv - конвертер изображений WebP/PNG/JPEG\n")
 		fmt.Fprintf(os.Stderr, "=====================\n\n")
 		fmt.Fprintf(os.Stderr, "Использование:\n")
-		fmt.Fprintf(os.Stderr, "  %s <входной_файл.webp> [выходной_файл.png]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s <директория> [выходная_директория]\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Примеры:\n")
+		fmt.Fprintf(os.Stderr, "  %s [флаги] <входной_файл> [выходной_файл]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s [флаги] <директория> [выходная_директория]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Флаги:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nПримеры:\n")
 		fmt.Fprintf(os.Stderr, "  %s image.webp\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s image.webp output.png\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -format webp image.png image.webp\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s ./images\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s ./images ./converted\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -format webp -method 6 ./images ./converted\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -recursive -include '**/*.webp' -exclude 'node_modules/**' ./images ./converted\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -thumbnails 32,128,512 icon.webp\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -animated gif sticker.webp sticker.gif\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  curl -s https://example.com/pic.webp | %s -format png - - > pic.png\n", os.Args[0])
 	}
 
 	flag.Parse()
@@ -192,12 +393,50 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *skipExisting && *overwrite {
+		fmt.Fprintf(os.Stderr, "Ошибка: -skip-existing и -overwrite взаимоисключающие\n")
+		os.Exit(1)
+	}
+	walkOpts := WalkOptions{Recursive: *recursive, Include: *include, Exclude: *exclude, SkipExisting: *skipExisting, Overwrite: *overwrite}
+
+	thumbnailSizes, err := imgconv.ParseThumbnailSizes(*thumbnails)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *animated != imgconv.AnimatedFirstFrame && *animated != imgconv.AnimatedPNG && *animated != imgconv.AnimatedGIF {
+		fmt.Fprintf(os.Stderr, "Ошибка: -animated должен быть одним из: %s, %s, %s\n", imgconv.AnimatedPNG, imgconv.AnimatedGIF, imgconv.AnimatedFirstFrame)
+		os.Exit(1)
+	}
+
+	opts := imgconv.Options{
+		Format:           *format,
+		Encode:           imgconv.EncodeOptions{CompressionLevel: *method},
+		Resize:           imgconv.ResizeOptions{Width: *width, Height: *height, MaxDim: *maxDim, Fit: *fit, Thumbnails: thumbnailSizes},
+		Animated:         *animated,
+		PreserveMetadata: *preserveMetadata,
+	}
+
 	input := args[0]
 	output := ""
 	if len(args) > 1 {
 		output = args[1]
 	}
 
+	// "-" означает стандартный ввод: путь к директории не имеет смысла, поэтому
+	// сразу конвертируем как один файл (выход по умолчанию - тоже "-", то есть stdout)
+	if input == "-" {
+		if output == "" {
+			output = "-"
+		}
+		if err := imgconv.ConvertFile(input, output, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Проверяем, что входной путь существует
 	info, err := os.Stat(input)
 	if err != nil {
@@ -206,21 +445,25 @@ func main() {
 	}
 
 	if info.IsDir() {
-		// Конвертируем все WebP файлы в директории
-		err := convertDirectory(input, output)
+		// Конвертируем все файлы в директории
+		err := convertDirectory(input, output, opts, *workers, walkOpts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
 			os.Exit(1)
 		}
 	} else {
 		// Конвертируем один файл
+		ext, err := imgconv.TargetExt(input, *format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			os.Exit(1)
+		}
 		if output == "" {
-			// Если выходной файл не указан, создаем PNG с тем же именем
-			output = strings.TrimSuffix(input, filepath.Ext(input)) + ".png"
+			// Если выходной файл не указан, создаем файл с тем же именем и нужным расширением
+			output = strings.TrimSuffix(input, filepath.Ext(input)) + ext
 		}
 
-		err := convertWebPToPNG(input, output)
-		if err != nil {
+		if err := imgconv.ConvertFile(input, output, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
 			os.Exit(1)
 		}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"точное совпадение", "image.webp", "image.webp", true},
+		{"* не пересекает директории", "*.webp", "sub/image.webp", false},
+		{"* совпадает в пределах одного уровня", "*.webp", "image.webp", true},
+		{"? совпадает с одним символом", "image?.webp", "image1.webp", true},
+		{"? не совпадает с несколькими символами", "image?.webp", "image12.webp", false},
+		{"** совпадает с любой глубиной вложенности", "**/*.webp", "a/b/c/image.webp", true},
+		{"** совпадает и с верхним уровнем", "**/*.webp", "image.webp", true},
+		{"** в конце совпадает со всем под префиксом", "node_modules/**", "node_modules/pkg/index.webp", true},
+		{"** в конце не совпадает вне префикса", "node_modules/**", "src/index.webp", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := globToRegexp(tt.pattern).MatchString(tt.path)
+			if got != tt.want {
+				t.Errorf("globToRegexp(%q).MatchString(%q) = %v, хотели %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		relPath string
+		include string
+		exclude string
+		want    bool
+	}{
+		{"без фильтров - все проходит", "a/b.webp", "", "", true},
+		{"include совпадает", "a/b.webp", "**/*.webp", "", true},
+		{"include не совпадает", "a/b.png", "**/*.webp", "", false},
+		{"exclude отбрасывает совпадение", "node_modules/a.webp", "**/*.webp", "node_modules/**", false},
+		{"include и непересекающийся exclude", "src/a.webp", "**/*.webp", "node_modules/**", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchesFilters(tt.relPath, tt.include, tt.exclude)
+			if got != tt.want {
+				t.Errorf("matchesFilters(%q, %q, %q) = %v, хотели %v", tt.relPath, tt.include, tt.exclude, got, tt.want)
+			}
+		})
+	}
+}
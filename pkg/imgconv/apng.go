@@ -0,0 +1,183 @@
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"time"
+)
+
+// pngChunk - это один chunk внутри обычного PNG-файла: тип и payload (без длины и CRC).
+type pngChunk struct {
+	chunkType string
+	data      []byte
+}
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// parsePNGChunks разбирает PNG, закодированный стандартным image/png, на составляющие
+// chunk-и, чтобы можно было переиспользовать его IHDR/IDAT при сборке APNG.
+func parsePNGChunks(data []byte) ([]pngChunk, error) {
+	if len(data) < 8 || !bytes.Equal(data[:8], pngSignature) {
+		return nil, fmt.Errorf("не PNG файл")
+	}
+
+	var chunks []pngChunk
+	pos := 8
+	for pos+8 <= len(data) {
+		length := binary.BigEndian.Uint32(data[pos : pos+4])
+		chunkType := string(data[pos+4 : pos+8])
+		start := pos + 8
+		end := start + int(length)
+		if end+4 > len(data) {
+			return nil, fmt.Errorf("поврежденный PNG chunk %s", chunkType)
+		}
+		chunks = append(chunks, pngChunk{chunkType: chunkType, data: data[start:end]})
+		pos = end + 4 // пропускаем CRC
+	}
+	return chunks, nil
+}
+
+// writePNGChunk пишет один PNG chunk: 4-байтная длина, тип, данные, CRC32 по типу+данным.
+func writePNGChunk(w io.Writer, chunkType string, data []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+
+	typeAndData := append([]byte(chunkType), data...)
+	if _, err := w.Write(typeAndData); err != nil {
+		return err
+	}
+
+	var crcBuf [4]byte
+	binary.BigEndian.PutUint32(crcBuf[:], crc32.ChecksumIEEE(typeAndData))
+	_, err := w.Write(crcBuf[:])
+	return err
+}
+
+// frameDelayFraction преобразует длительность кадра в пару delay_num/delay_den из 2017
+// PNG spec extension (APNG fcTL), в миллисекундах/1000.
+func frameDelayFraction(d time.Duration) (uint16, uint16) {
+	ms := d.Milliseconds()
+	if ms <= 0 {
+		ms = 100
+	}
+	if ms > 0xFFFF {
+		ms = 0xFFFF
+	}
+	return uint16(ms), 1000
+}
+
+// encodeAPNG кодирует уже скомпонованные кадры (каждый - полный снимок канвы) в анимированный
+// PNG: IHDR, acTL, затем fcTL и стандартные IDAT первого кадра, затем пары fcTL+fdAT для остальных.
+// Каждый кадр кодируется через стандартный image/png, а его IDAT chunk-и переиспользуются
+// как есть (для первого кадра) или оборачиваются в fdAT с номером последовательности.
+func encodeAPNG(w io.Writer, composed []*image.NRGBA, frames []webpFrame, loopCount int) error {
+	if len(composed) == 0 {
+		return fmt.Errorf("нет кадров для кодирования")
+	}
+
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+
+	seq := uint32(0)
+	for i, img := range composed {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return fmt.Errorf("не удалось закодировать кадр %d: %w", i, err)
+		}
+		chunks, err := parsePNGChunks(buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		var ihdr []byte
+		var idatParts [][]byte
+		for _, c := range chunks {
+			switch c.chunkType {
+			case "IHDR":
+				ihdr = c.data
+			case "IDAT":
+				idatParts = append(idatParts, c.data)
+			}
+		}
+
+		if i == 0 {
+			if err := writePNGChunk(w, "IHDR", ihdr); err != nil {
+				return err
+			}
+			acTL := make([]byte, 8)
+			binary.BigEndian.PutUint32(acTL[0:4], uint32(len(composed)))
+			binary.BigEndian.PutUint32(acTL[4:8], uint32(loopCount))
+			if err := writePNGChunk(w, "acTL", acTL); err != nil {
+				return err
+			}
+		}
+
+		fcTL := make([]byte, 26)
+		binary.BigEndian.PutUint32(fcTL[0:4], seq)
+		seq++
+		bounds := img.Bounds()
+		binary.BigEndian.PutUint32(fcTL[4:8], uint32(bounds.Dx()))
+		binary.BigEndian.PutUint32(fcTL[8:12], uint32(bounds.Dy()))
+		binary.BigEndian.PutUint32(fcTL[12:16], 0) // x_offset
+		binary.BigEndian.PutUint32(fcTL[16:20], 0) // y_offset
+		delayNum, delayDen := frameDelayFraction(frames[i].duration)
+		binary.BigEndian.PutUint16(fcTL[20:22], delayNum)
+		binary.BigEndian.PutUint16(fcTL[22:24], delayDen)
+		fcTL[24] = 0 // dispose_op: none - кадры уже полностью скомпонованы
+		fcTL[25] = 0 // blend_op: source
+		if err := writePNGChunk(w, "fcTL", fcTL); err != nil {
+			return err
+		}
+
+		if i == 0 {
+			for _, part := range idatParts {
+				if err := writePNGChunk(w, "IDAT", part); err != nil {
+					return err
+				}
+			}
+		} else {
+			for _, part := range idatParts {
+				fdATData := make([]byte, 4+len(part))
+				binary.BigEndian.PutUint32(fdATData[0:4], seq)
+				seq++
+				copy(fdATData[4:], part)
+				if err := writePNGChunk(w, "fdAT", fdATData); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return writePNGChunk(w, "IEND", nil)
+}
+
+// encodeAnimatedGIF кодирует уже скомпонованные кадры в анимированный GIF, квантуя каждый
+// кадр под фиксированную палитру через дизеринг Флойда-Стейнберга.
+func encodeAnimatedGIF(w io.Writer, composed []*image.NRGBA, frames []webpFrame, loopCount int) error {
+	out := &gif.GIF{LoopCount: loopCount}
+	for i, frame := range composed {
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, frame.Bounds(), frame, image.Point{})
+
+		delay := int(frames[i].duration / (10 * time.Millisecond)) // GIF-задержка в сотых долях секунды
+		if delay <= 0 {
+			delay = 10
+		}
+
+		out.Image = append(out.Image, paletted)
+		out.Delay = append(out.Delay, delay)
+	}
+	return gif.EncodeAll(w, out)
+}
@@ -0,0 +1,323 @@
+// Package imgconv реализует конвертацию изображений между WebP, PNG и JPEG:
+// декодирование/кодирование, изменение размера, поддержку анимации и перенос метаданных.
+// main.go - это тонкая CLI-обертка над этим пакетом; сам пакет не знает о флагах
+// командной строки и пригоден для использования как библиотека в других программах.
+package imgconv
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/webp"
+)
+
+// EncodeOptions описывает параметры кодирования WebP при конвертации в обратную сторону.
+// nativewebp кодирует только без потерь (VP8L) - отдельного lossy-режима (VP8/-quality)
+// у этой библиотеки нет, поэтому единственный реальный параметр - уровень сжатия.
+type EncodeOptions struct {
+	CompressionLevel int // компромисс скорость/сжатие при кодировании VP8L, 0 (быстро) - 6 (максимальное сжатие)
+}
+
+// ResizeOptions описывает опциональное изменение размера перед кодированием.
+type ResizeOptions struct {
+	Width      int    // целевая ширина, 0 - определяется по Height с сохранением пропорций
+	Height     int    // целевая высота, 0 - определяется по Width с сохранением пропорций
+	MaxDim     int    // ограничить большую сторону этим значением, сохраняя пропорции
+	Fit        string // contain (по умолчанию), cover или stretch - только когда заданы Width и Height
+	Thumbnails []int  // дополнительные размеры миниатюр, например [32, 128, 512]
+}
+
+// hasResize сообщает, нужно ли вообще менять размер изображения.
+func (r ResizeOptions) hasResize() bool {
+	return r.Width > 0 || r.Height > 0 || r.MaxDim > 0
+}
+
+// Допустимые значения Options.Animated (они же значения флага -animated в CLI).
+const (
+	AnimatedFirstFrame = "first-frame"
+	AnimatedPNG        = "png"
+	AnimatedGIF        = "gif"
+)
+
+// Options описывает все параметры одной конвертации.
+type Options struct {
+	Format           string // "webp" или "png"; пусто - определяется по расширению выходного файла
+	Encode           EncodeOptions
+	Resize           ResizeOptions
+	Animated         string // режим обработки анимированного WebP: AnimatedPNG/AnimatedGIF/AnimatedFirstFrame
+	PreserveMetadata bool   // переносить EXIF/XMP/ICC метаданные WebP в выходной PNG
+}
+
+// Convert конвертирует изображение из r в w согласно opts.Format ("webp" или "png",
+// по умолчанию "png"). В отличие от ConvertFile, не умеет писать миниатюры
+// (ResizeOptions.Thumbnails) - это отдельные файлы, для них нужен путь на диске.
+func Convert(r io.Reader, w io.Writer, opts Options) error {
+	inputData, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать вход: %w", err)
+	}
+
+	if opts.Format == "webp" {
+		return convertToWebP(inputData, w, opts)
+	}
+	return convertToPNG(inputData, w, opts)
+}
+
+// ConvertFile конвертирует inputPath в outputPath, выбирая кодировщик по целевому
+// расширению (или opts.Format, если задан явно). Путь "-" означает стандартный
+// ввод/вывод, что позволяет использовать пакет в Unix-пайплайнах
+// (например, `imgconv - - < in.webp > out.png`).
+func ConvertFile(inputPath, outputPath string, opts Options) error {
+	if opts.Format == "" {
+		if strings.ToLower(filepath.Ext(outputPath)) == ".webp" {
+			opts.Format = "webp"
+		} else {
+			opts.Format = "png"
+		}
+	}
+
+	in, err := openInput(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	inputData, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать файл: %w", err)
+	}
+
+	// Миниатюры - это дополнительные файлы рядом с outputPath, поэтому их можно
+	// писать только в файловом режиме, а не при потоковой конвертации через "-".
+	if len(opts.Resize.Thumbnails) > 0 && outputPath != "-" {
+		if img, decErr := decodeImage(inputData); decErr == nil {
+			if err := writeThumbnails(img, outputPath, opts.Resize.Thumbnails); err != nil {
+				return err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if opts.Format == "webp" {
+		err = convertToWebP(inputData, &buf, opts)
+	} else {
+		err = convertToPNG(inputData, &buf, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(outputPath, buf.Bytes())
+}
+
+// openInput открывает inputPath для чтения; "-" означает стандартный ввод.
+func openInput(inputPath string) (io.ReadCloser, error) {
+	if inputPath == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл: %w", err)
+	}
+	return f, nil
+}
+
+// writeOutput записывает data в outputPath; "-" означает стандартный вывод.
+func writeOutput(outputPath string, data []byte) error {
+	if outputPath == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("не удалось создать выходной файл: %w", err)
+	}
+	defer outputFile.Close()
+
+	if _, err := outputFile.Write(data); err != nil {
+		return fmt.Errorf("не удалось записать файл: %w", err)
+	}
+
+	return outputFile.Sync()
+}
+
+// convertToPNG декодирует WebP (с учетом анимации и метаданных) или PNG/JPEG и
+// кодирует результат в PNG, записывая его в w.
+func convertToPNG(inputData []byte, w io.Writer, opts Options) error {
+	if opts.Animated != AnimatedFirstFrame && isAnimatedWebP(inputData) {
+		return convertAnimatedWebP(inputData, w, opts.Animated)
+	}
+
+	img, err := decodeImage(inputData)
+	if err != nil {
+		return err
+	}
+
+	if opts.Resize.hasResize() {
+		img = applyResize(img, opts.Resize)
+	}
+
+	// Кодируем в PNG в памяти, чтобы при необходимости вставить метаданные перед записью
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		return fmt.Errorf("не удалось закодировать PNG: %w", err)
+	}
+
+	pngData := pngBuf.Bytes()
+	if opts.PreserveMetadata {
+		meta := extractWebPMetadata(inputData)
+		pngData, err = embedMetadataInPNG(pngData, meta)
+		if err != nil {
+			return fmt.Errorf("не удалось сохранить метаданные: %w", err)
+		}
+	}
+
+	_, err = w.Write(pngData)
+	return err
+}
+
+// convertAnimatedWebP декодирует все кадры анимированного WebP (chunk-и ANIM/ANMF),
+// компонует их на канве с учетом blend/dispose каждого кадра и кодирует результат
+// в анимированный PNG (APNG) либо GIF, в зависимости от animated.
+func convertAnimatedWebP(inputData []byte, w io.Writer, animated string) error {
+	frames, canvasW, canvasH, loopCount, background, err := decodeAnimatedWebP(inputData)
+	if err != nil {
+		return fmt.Errorf("не удалось разобрать анимированный WebP: %w", err)
+	}
+
+	composed := compositeFrames(frames, canvasW, canvasH, background)
+
+	if animated == AnimatedGIF {
+		err = encodeAnimatedGIF(w, composed, frames, loopCount)
+	} else {
+		err = encodeAPNG(w, composed, frames, loopCount)
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось закодировать анимацию: %w", err)
+	}
+	return nil
+}
+
+// convertToWebP декодирует PNG или JPEG изображение и кодирует его в WebP по opts.Encode.
+func convertToWebP(inputData []byte, w io.Writer, opts Options) error {
+	img, err := decodeImage(inputData)
+	if err != nil {
+		return err
+	}
+
+	if opts.Resize.hasResize() {
+		img = applyResize(img, opts.Resize)
+	}
+
+	err = nativewebp.Encode(w, img, &nativewebp.Options{
+		CompressionLevel: nativewebp.CompressionLevel(opts.Encode.CompressionLevel),
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось закодировать WebP: %w", err)
+	}
+	return nil
+}
+
+// decodeImage пытается декодировать данные как WebP, затем PNG, затем JPEG.
+func decodeImage(inputData []byte) (image.Image, error) {
+	img, err := webp.Decode(bytes.NewReader(inputData))
+	if err == nil {
+		return img, nil
+	}
+
+	img, pngErr := png.Decode(bytes.NewReader(inputData))
+	if pngErr == nil {
+		return img, nil
+	}
+
+	// Некоторые файлы с расширением .webp на самом деле являются JPEG
+	img, jpegErr := jpeg.Decode(bytes.NewReader(inputData))
+	if jpegErr == nil {
+		return img, nil
+	}
+
+	return nil, fmt.Errorf("не удалось декодировать изображение (пробовались форматы WebP, PNG и JPEG): %w", err)
+}
+
+// applyResize изменяет размер img согласно r, используя ресемплинг Lanczos3.
+func applyResize(img image.Image, r ResizeOptions) image.Image {
+	switch {
+	case r.Width > 0 && r.Height > 0:
+		switch r.Fit {
+		case "cover":
+			return imaging.Fill(img, r.Width, r.Height, imaging.Center, imaging.Lanczos)
+		case "stretch":
+			return imaging.Resize(img, r.Width, r.Height, imaging.Lanczos)
+		default: // "contain"
+			return imaging.Fit(img, r.Width, r.Height, imaging.Lanczos)
+		}
+	case r.Width > 0:
+		return imaging.Resize(img, r.Width, 0, imaging.Lanczos)
+	case r.Height > 0:
+		return imaging.Resize(img, 0, r.Height, imaging.Lanczos)
+	case r.MaxDim > 0:
+		return imaging.Fit(img, r.MaxDim, r.MaxDim, imaging.Lanczos)
+	default:
+		return img
+	}
+}
+
+// writeThumbnails сохраняет по одному PNG на каждый размер из sizes рядом с outputPath,
+// в виде <имя>_<размер>px.png, например image_32px.png.
+func writeThumbnails(img image.Image, outputPath string, sizes []int) error {
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	for _, size := range sizes {
+		thumb := imaging.Fit(img, size, size, imaging.Lanczos)
+		thumbPath := fmt.Sprintf("%s_%dpx.png", base, size)
+		if err := imaging.Save(thumb, thumbPath); err != nil {
+			return fmt.Errorf("не удалось сохранить миниатюру %s: %w", thumbPath, err)
+		}
+	}
+	return nil
+}
+
+// ParseThumbnailSizes парсит список через запятую, например "32,128,512".
+func ParseThumbnailSizes(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	sizes := make([]int, 0, len(parts))
+	for _, part := range parts {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("некорректный размер миниатюры: %q", part)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// TargetExt определяет расширение выходного файла по явному формату format
+// ("png"/"webp") либо, если он не задан, по расширению исходного файла (webp -> png).
+func TargetExt(inputPath, format string) (string, error) {
+	switch format {
+	case "png":
+		return ".png", nil
+	case "webp":
+		return ".webp", nil
+	case "":
+		if strings.ToLower(filepath.Ext(inputPath)) == ".webp" {
+			return ".png", nil
+		}
+		return "", fmt.Errorf("для конвертации %s требуется явно указать -format webp|png", inputPath)
+	default:
+		return "", fmt.Errorf("неизвестный формат: %s (ожидается webp или png)", format)
+	}
+}
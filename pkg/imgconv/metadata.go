@@ -0,0 +1,126 @@
+package imgconv
+
+import (
+	"bytes"
+	"compress/zlib"
+)
+
+// imageMetadata хранит метаданные цвета/ориентации/происхождения, которые WebP
+// держит в отдельных RIFF chunk-ах, чтобы перенести их в собственные ancillary chunk-и PNG.
+type imageMetadata struct {
+	ICCProfile []byte // из chunk-а ICCP
+	EXIF       []byte // из chunk-а EXIF
+	XMP        []byte // из chunk-а "XMP "
+}
+
+func (m imageMetadata) isEmpty() bool {
+	return len(m.ICCProfile) == 0 && len(m.EXIF) == 0 && len(m.XMP) == 0
+}
+
+// extractWebPMetadata читает ICCP/EXIF/"XMP " chunk-и из RIFF-контейнера WebP.
+// Эти chunk-и присутствуют только когда заголовок VP8X расширенный.
+func extractWebPMetadata(data []byte) imageMetadata {
+	chunks, err := parseRIFFChunks(data)
+	if err != nil {
+		return imageMetadata{}
+	}
+
+	var meta imageMetadata
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "ICCP":
+			meta.ICCProfile = c.data
+		case "EXIF":
+			meta.EXIF = c.data
+		case "XMP ":
+			meta.XMP = c.data
+		}
+	}
+	return meta
+}
+
+// exifHeader - необязательный префикс EXIF-блока в WebP/JPEG; 2017 PNG spec extension
+// для eXIf ожидает сырой TIFF-блок без этого префикса.
+var exifHeader = []byte("Exif\x00\x00")
+
+// embedMetadataInPNG вставляет iCCP/eXIf/iTXt (XMP) chunk-и сразу после IHDR в уже
+// закодированный PNG. Возвращает pngData как есть, если meta пуста.
+func embedMetadataInPNG(pngData []byte, meta imageMetadata) ([]byte, error) {
+	if meta.isEmpty() {
+		return pngData, nil
+	}
+
+	chunks, err := parsePNGChunks(pngData)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+
+	for _, c := range chunks {
+		if err := writePNGChunk(&buf, c.chunkType, c.data); err != nil {
+			return nil, err
+		}
+		if c.chunkType != "IHDR" {
+			continue
+		}
+
+		if len(meta.ICCProfile) > 0 {
+			iccp, err := buildICCPChunk(meta.ICCProfile)
+			if err != nil {
+				return nil, err
+			}
+			if err := writePNGChunk(&buf, "iCCP", iccp); err != nil {
+				return nil, err
+			}
+		}
+		if len(meta.EXIF) > 0 {
+			exif := bytes.TrimPrefix(meta.EXIF, exifHeader)
+			if err := writePNGChunk(&buf, "eXIf", exif); err != nil {
+				return nil, err
+			}
+		}
+		if len(meta.XMP) > 0 {
+			if err := writePNGChunk(&buf, "iTXt", buildXMPChunk(meta.XMP)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// buildICCPChunk кодирует iCCP: имя профиля (null-terminated) + метод сжатия (0 = zlib) +
+// zlib-сжатый ICC профиль.
+func buildICCPChunk(profile []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(profile); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("icc") // имя профиля; содержимое не критично для рендеринга
+	out.WriteByte(0)       // null-terminator имени
+	out.WriteByte(0)       // метод сжатия: 0 = zlib/deflate
+	out.Write(compressed.Bytes())
+	return out.Bytes(), nil
+}
+
+// buildXMPChunk кодирует iTXt с ключевым словом "XML:com.adobe.xmp" - стандартный способ
+// хранения XMP в PNG.
+func buildXMPChunk(xmp []byte) []byte {
+	var out bytes.Buffer
+	out.WriteString("XML:com.adobe.xmp")
+	out.WriteByte(0) // null-terminator ключевого слова
+	out.WriteByte(0) // флаг сжатия: 0 = без сжатия
+	out.WriteByte(0) // метод сжатия
+	out.WriteByte(0) // тег языка (пустой, null-terminated)
+	out.WriteByte(0) // переведенное ключевое слово (пустое, null-terminated)
+	out.Write(xmp)
+	return out.Bytes()
+}
@@ -0,0 +1,145 @@
+package imgconv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestEmbedMetadataInPNG(t *testing.T) {
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, image.NewNRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("не удалось закодировать тестовый PNG: %v", err)
+	}
+
+	t.Run("пустые метаданные не меняют данные", func(t *testing.T) {
+		out, err := embedMetadataInPNG(pngBuf.Bytes(), imageMetadata{})
+		if err != nil {
+			t.Fatalf("embedMetadataInPNG() вернул ошибку: %v", err)
+		}
+		if !bytes.Equal(out, pngBuf.Bytes()) {
+			t.Error("embedMetadataInPNG() с пустыми метаданными изменил содержимое PNG")
+		}
+	})
+
+	t.Run("ICC/EXIF/XMP вставляются после IHDR", func(t *testing.T) {
+		meta := imageMetadata{
+			ICCProfile: []byte("fake icc profile"),
+			EXIF:       append(append([]byte{}, exifHeader...), []byte("fake exif")...),
+			XMP:        []byte("<x:xmpmeta/>"),
+		}
+
+		out, err := embedMetadataInPNG(pngBuf.Bytes(), meta)
+		if err != nil {
+			t.Fatalf("embedMetadataInPNG() вернул ошибку: %v", err)
+		}
+
+		chunks, err := parsePNGChunks(out)
+		if err != nil {
+			t.Fatalf("не удалось разобрать результат embedMetadataInPNG(): %v", err)
+		}
+
+		wantOrder := []string{"IHDR", "iCCP", "eXIf", "iTXt"}
+		if len(chunks) < len(wantOrder) {
+			t.Fatalf("в результате %d chunk-ов, хотели не меньше %d", len(chunks), len(wantOrder))
+		}
+		for i, want := range wantOrder {
+			if chunks[i].chunkType != want {
+				t.Errorf("chunk %d = %s, хотели %s (метаданные сразу после IHDR)", i, chunks[i].chunkType, want)
+			}
+		}
+
+		var gotICCP, gotEXIF, gotXMP bool
+		for _, c := range chunks {
+			switch c.chunkType {
+			case "iCCP":
+				gotICCP = true
+			case "eXIf":
+				gotEXIF = true
+				if !bytes.Equal(c.data, []byte("fake exif")) {
+					t.Errorf("eXIf содержит %q, хотели без префикса %q", c.data, exifHeader)
+				}
+			case "iTXt":
+				gotXMP = true
+			}
+		}
+
+		if !gotICCP {
+			t.Error("iCCP chunk не найден в результате")
+		}
+		if !gotEXIF {
+			t.Error("eXIf chunk не найден в результате")
+		}
+		if !gotXMP {
+			t.Error("iTXt (XMP) chunk не найден в результате")
+		}
+	})
+}
+
+func TestBuildICCPChunk(t *testing.T) {
+	profile := []byte("some icc profile bytes")
+	chunk, err := buildICCPChunk(profile)
+	if err != nil {
+		t.Fatalf("buildICCPChunk() вернул ошибку: %v", err)
+	}
+
+	nameEnd := bytes.IndexByte(chunk, 0)
+	if nameEnd == -1 {
+		t.Fatal("buildICCPChunk() не содержит null-terminator имени профиля")
+	}
+
+	compressionMethod := chunk[nameEnd+1]
+	if compressionMethod != 0 {
+		t.Errorf("метод сжатия = %d, хотели 0 (zlib)", compressionMethod)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(chunk[nameEnd+2:]))
+	if err != nil {
+		t.Fatalf("не удалось открыть zlib-поток: %v", err)
+	}
+	defer zr.Close()
+
+	decompressed, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("не удалось распаковать zlib-поток: %v", err)
+	}
+	if !bytes.Equal(decompressed, profile) {
+		t.Errorf("распакованный профиль = %q, хотели %q", decompressed, profile)
+	}
+}
+
+func TestBuildXMPChunk(t *testing.T) {
+	xmp := []byte("<x:xmpmeta>hello</x:xmpmeta>")
+	chunk := buildXMPChunk(xmp)
+
+	if !bytes.HasPrefix(chunk, []byte("XML:com.adobe.xmp\x00")) {
+		t.Error("buildXMPChunk() не начинается с ожидаемого ключевого слова iTXt")
+	}
+	if !bytes.HasSuffix(chunk, xmp) {
+		t.Error("buildXMPChunk() не заканчивается исходными XMP-данными")
+	}
+}
+
+func TestImageMetadataIsEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		meta imageMetadata
+		want bool
+	}{
+		{"пусто", imageMetadata{}, true},
+		{"только ICC", imageMetadata{ICCProfile: []byte{1}}, false},
+		{"только EXIF", imageMetadata{EXIF: []byte{1}}, false},
+		{"только XMP", imageMetadata{XMP: []byte{1}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.meta.isEmpty(); got != tt.want {
+				t.Errorf("isEmpty() = %v, хотели %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package imgconv
+
+import (
+	"image"
+	"testing"
+)
+
+func TestApplyResize(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 50)) // соотношение сторон 2:1
+
+	tests := []struct {
+		name       string
+		resize     ResizeOptions
+		wantWidth  int
+		wantHeight int
+	}{
+		{"только ширина сохраняет пропорции", ResizeOptions{Width: 50}, 50, 25},
+		{"только высота сохраняет пропорции", ResizeOptions{Height: 10}, 20, 10},
+		{"max-dim ограничивает большую сторону", ResizeOptions{MaxDim: 20}, 20, 10},
+		{"fit contain вписывает с сохранением пропорций", ResizeOptions{Width: 40, Height: 40, Fit: "contain"}, 40, 20},
+		{"fit stretch растягивает без сохранения пропорций", ResizeOptions{Width: 40, Height: 40, Fit: "stretch"}, 40, 40},
+		{"fit cover заполняет с обрезкой", ResizeOptions{Width: 40, Height: 40, Fit: "cover"}, 40, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := applyResize(src, tt.resize)
+			bounds := out.Bounds()
+			if bounds.Dx() != tt.wantWidth || bounds.Dy() != tt.wantHeight {
+				t.Errorf("размер = %dx%d, хотели %dx%d", bounds.Dx(), bounds.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestResizeOptionsHasResize(t *testing.T) {
+	tests := []struct {
+		name   string
+		resize ResizeOptions
+		want   bool
+	}{
+		{"пусто", ResizeOptions{}, false},
+		{"только миниатюры не считаются изменением размера", ResizeOptions{Thumbnails: []int{32}}, false},
+		{"width", ResizeOptions{Width: 10}, true},
+		{"height", ResizeOptions{Height: 10}, true},
+		{"max-dim", ResizeOptions{MaxDim: 10}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.resize.hasResize(); got != tt.want {
+				t.Errorf("hasResize() = %v, хотели %v", got, tt.want)
+			}
+		})
+	}
+}
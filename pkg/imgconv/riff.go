@@ -0,0 +1,236 @@
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+// riffChunk - это один top-level или вложенный chunk внутри RIFF-контейнера WebP:
+// четырехбуквенный идентификатор (FourCC) и его payload без паддинга до четной длины.
+type riffChunk struct {
+	fourCC string
+	data   []byte
+}
+
+// parseRIFFChunks читает RIFF-контейнер WebP: 12-байтный заголовок "RIFF"+размер+"WEBP",
+// затем последовательность chunk-ов ("ANIM"/"ANMF"/"VP8X"/"VP8 "/"VP8L"/... + размер + payload).
+func parseRIFFChunks(data []byte) ([]riffChunk, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("не RIFF/WEBP контейнер")
+	}
+	return parseChunkSequence(data[12:])
+}
+
+// parseChunkSequence разбирает последовательность chunk-ов: 4 байта FourCC, 4 байта
+// LE-размер, payload, выровненный до четной длины. Используется как для top-level
+// chunk-ов WebP, так и для вложенных chunk-ов внутри одного кадра ANMF.
+func parseChunkSequence(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+	pos := 0
+	for pos+8 <= len(data) {
+		fourCC := string(data[pos : pos+4])
+		size := binary.LittleEndian.Uint32(data[pos+4 : pos+8])
+		start := pos + 8
+		end := start + int(size)
+		if end > len(data) {
+			return nil, fmt.Errorf("поврежденный chunk %s: выходит за пределы файла", fourCC)
+		}
+		chunks = append(chunks, riffChunk{fourCC: fourCC, data: data[start:end]})
+
+		pos = end
+		if size%2 == 1 {
+			pos++ // выравнивание до четной длины
+		}
+	}
+	return chunks, nil
+}
+
+// isAnimatedWebP сообщает, содержит ли WebP-файл флаг анимации (бит 1 VP8X) -
+// то есть может ли он иметь несколько кадров ANMF.
+func isAnimatedWebP(data []byte) bool {
+	chunks, err := parseRIFFChunks(data)
+	if err != nil {
+		return false
+	}
+	for _, c := range chunks {
+		if c.fourCC == "VP8X" && len(c.data) >= 1 && c.data[0]&0x02 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// webpFrame - это один декодированный и расположенный на канве кадр анимированного WebP.
+type webpFrame struct {
+	x, y                int
+	width, height       int
+	duration            time.Duration
+	blend               bool // true: alpha-blend поверх канвы, false: перезаписать (overwrite)
+	disposeToBackground bool // true: после отрисовки кадра восстановить фон перед следующим
+	img                 image.Image
+}
+
+// decodeAnimatedWebP разбирает VP8X/ANIM/ANMF chunk-и анимированного WebP и декодирует
+// каждый кадр. Возвращает кадры в порядке анимации вместе с размером канвы, числом
+// повторов анимации (0 - бесконечно) и цветом фона.
+func decodeAnimatedWebP(data []byte) (frames []webpFrame, canvasW, canvasH, loopCount int, background color.NRGBA, err error) {
+	chunks, err := parseRIFFChunks(data)
+	if err != nil {
+		return nil, 0, 0, 0, background, err
+	}
+
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "VP8X":
+			if len(c.data) < 10 {
+				return nil, 0, 0, 0, background, fmt.Errorf("некорректный VP8X chunk")
+			}
+			canvasW = 1 + int(c.data[4]) + int(c.data[5])<<8 + int(c.data[6])<<16
+			canvasH = 1 + int(c.data[7]) + int(c.data[8])<<8 + int(c.data[9])<<16
+		case "ANIM":
+			if len(c.data) < 6 {
+				return nil, 0, 0, 0, background, fmt.Errorf("некорректный ANIM chunk")
+			}
+			// Фон хранится как BGRA, а не RGBA
+			background = color.NRGBA{B: c.data[0], G: c.data[1], R: c.data[2], A: c.data[3]}
+			loopCount = int(binary.LittleEndian.Uint16(c.data[4:6]))
+		case "ANMF":
+			frame, ferr := parseANMF(c.data)
+			if ferr != nil {
+				return nil, 0, 0, 0, background, ferr
+			}
+			frames = append(frames, frame)
+		}
+	}
+
+	if len(frames) == 0 {
+		return nil, 0, 0, 0, background, fmt.Errorf("WebP не содержит кадров анимации (ANMF)")
+	}
+	if canvasW == 0 || canvasH == 0 {
+		canvasW, canvasH = frames[0].width, frames[0].height
+	}
+
+	return frames, canvasW, canvasH, loopCount, background, nil
+}
+
+// parseANMF разбирает один chunk ANMF: 16-байтный заголовок кадра (позиция, размер,
+// длительность и флаги blend/dispose), за которым следуют вложенные chunk-и с самим
+// битстримом кадра (опционально ALPH, затем VP8 или VP8L).
+func parseANMF(data []byte) (webpFrame, error) {
+	if len(data) < 16 {
+		return webpFrame{}, fmt.Errorf("некорректный ANMF chunk")
+	}
+
+	x := 2 * (int(data[0]) + int(data[1])<<8 + int(data[2])<<16)
+	y := 2 * (int(data[3]) + int(data[4])<<8 + int(data[5])<<16)
+	width := 1 + int(data[6]) + int(data[7])<<8 + int(data[8])<<16
+	height := 1 + int(data[9]) + int(data[10])<<8 + int(data[11])<<16
+	durationMs := int(data[12]) + int(data[13])<<8 + int(data[14])<<16
+	flags := data[15]
+	disposeToBackground := flags&0x01 != 0 // бит 0: 1 = восстановить фон после кадра
+	blend := flags&0x02 == 0               // бит 1: 0 = alpha-blend, 1 = перезаписать
+
+	subChunks, err := parseChunkSequence(data[16:])
+	if err != nil {
+		return webpFrame{}, fmt.Errorf("не удалось разобрать кадр ANMF: %w", err)
+	}
+
+	frameData, err := buildSingleImageWebP(subChunks, width, height)
+	if err != nil {
+		return webpFrame{}, err
+	}
+	img, err := webp.Decode(bytes.NewReader(frameData))
+	if err != nil {
+		return webpFrame{}, fmt.Errorf("не удалось декодировать битстрим кадра: %w", err)
+	}
+
+	return webpFrame{
+		x: x, y: y, width: width, height: height,
+		duration:            time.Duration(durationMs) * time.Millisecond,
+		blend:               blend,
+		disposeToBackground: disposeToBackground,
+		img:                 img,
+	}, nil
+}
+
+// buildSingleImageWebP пересобирает вложенные chunk-и одного кадра ANMF (ALPH + VP8/VP8L)
+// в отдельный самодостаточный WebP-файл, который можно скормить стандартному декодеру.
+func buildSingleImageWebP(chunks []riffChunk, width, height int) ([]byte, error) {
+	hasAlpha := false
+	for _, c := range chunks {
+		if c.fourCC == "ALPH" {
+			hasAlpha = true
+		}
+	}
+
+	var payload []riffChunk
+	if hasAlpha {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x10 // бит Alpha в VP8X
+		w, h := width-1, height-1
+		vp8x[4], vp8x[5], vp8x[6] = byte(w), byte(w>>8), byte(w>>16)
+		vp8x[7], vp8x[8], vp8x[9] = byte(h), byte(h>>8), byte(h>>16)
+		payload = append(payload, riffChunk{fourCC: "VP8X", data: vp8x})
+	}
+	payload = append(payload, chunks...)
+
+	return serializeRIFF(payload), nil
+}
+
+// serializeRIFF собирает список chunk-ов обратно в байты RIFF/WEBP-контейнера.
+func serializeRIFF(chunks []riffChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, c := range chunks {
+		body.WriteString(c.fourCC)
+		var sizeBuf [4]byte
+		binary.LittleEndian.PutUint32(sizeBuf[:], uint32(len(c.data)))
+		body.Write(sizeBuf[:])
+		body.Write(c.data)
+		if len(c.data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	var sizeBuf [4]byte
+	binary.LittleEndian.PutUint32(sizeBuf[:], uint32(body.Len()))
+	out.Write(sizeBuf[:])
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// compositeFrames накладывает кадры анимации друг на друга на канве нужного размера,
+// применяя blend/dispose методы каждого кадра, и возвращает полный снимок канвы после
+// каждого кадра - то есть ровно то, что должно быть видно зрителю в этот момент.
+func compositeFrames(frames []webpFrame, canvasW, canvasH int, background color.NRGBA) []*image.NRGBA {
+	canvas := image.NewNRGBA(image.Rect(0, 0, canvasW, canvasH))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+
+	composed := make([]*image.NRGBA, 0, len(frames))
+	for _, f := range frames {
+		frameRect := image.Rect(f.x, f.y, f.x+f.width, f.y+f.height)
+		if f.blend {
+			draw.Draw(canvas, frameRect, f.img, image.Point{}, draw.Over)
+		} else {
+			draw.Draw(canvas, frameRect, f.img, image.Point{}, draw.Src)
+		}
+
+		snapshot := image.NewNRGBA(canvas.Bounds())
+		draw.Draw(snapshot, snapshot.Bounds(), canvas, image.Point{}, draw.Src)
+		composed = append(composed, snapshot)
+
+		if f.disposeToBackground {
+			draw.Draw(canvas, frameRect, &image.Uniform{C: background}, image.Point{}, draw.Src)
+		}
+	}
+	return composed
+}
@@ -0,0 +1,128 @@
+package imgconv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+func TestParseChunkSequence(t *testing.T) {
+	t.Run("две chunk-и, одна с нечетной длиной и паддингом", func(t *testing.T) {
+		var data bytes.Buffer
+		writeTestChunk(&data, "ABCD", []byte("xyz")) // нечетная длина -> паддинг-байт
+		writeTestChunk(&data, "EFGH", []byte("1234"))
+
+		chunks, err := parseChunkSequence(data.Bytes())
+		if err != nil {
+			t.Fatalf("неожиданная ошибка: %v", err)
+		}
+		if len(chunks) != 2 {
+			t.Fatalf("ожидалось 2 chunk-а, получено %d", len(chunks))
+		}
+		if chunks[0].fourCC != "ABCD" || string(chunks[0].data) != "xyz" {
+			t.Errorf("chunk 0 = %+v", chunks[0])
+		}
+		if chunks[1].fourCC != "EFGH" || string(chunks[1].data) != "1234" {
+			t.Errorf("chunk 1 = %+v", chunks[1])
+		}
+	})
+
+	t.Run("chunk выходит за пределы данных", func(t *testing.T) {
+		var data bytes.Buffer
+		data.WriteString("ABCD")
+		var sizeBuf [4]byte
+		binary.LittleEndian.PutUint32(sizeBuf[:], 100)
+		data.Write(sizeBuf[:])
+		data.WriteString("short")
+
+		if _, err := parseChunkSequence(data.Bytes()); err == nil {
+			t.Fatal("ожидалась ошибка для chunk-а, выходящего за пределы данных")
+		}
+	})
+}
+
+// writeTestChunk пишет один RIFF chunk (FourCC + LE-размер + payload + паддинг) в buf.
+func writeTestChunk(buf *bytes.Buffer, fourCC string, payload []byte) {
+	buf.WriteString(fourCC)
+	var sizeBuf [4]byte
+	binary.LittleEndian.PutUint32(sizeBuf[:], uint32(len(payload)))
+	buf.Write(sizeBuf[:])
+	buf.Write(payload)
+	if len(payload)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// encodeVP8LChunk кодирует 1x1 изображение через nativewebp и возвращает его chunk VP8L,
+// чтобы собрать из него синтетический кадр ANMF для теста.
+func encodeVP8LChunk(t *testing.T) riffChunk {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("nativewebp.Encode: %v", err)
+	}
+	chunks, err := parseRIFFChunks(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parseRIFFChunks: %v", err)
+	}
+	for _, c := range chunks {
+		if c.fourCC == "VP8L" {
+			return c
+		}
+	}
+	t.Fatal("закодированный WebP не содержит chunk VP8L")
+	return riffChunk{}
+}
+
+// buildANMFPayload собирает payload chunk-а ANMF: 16-байтный заголовок кадра + вложенные chunk-и.
+func buildANMFPayload(width, height, durationMs int, flags byte, sub []riffChunk) []byte {
+	header := make([]byte, 16)
+	w, h := width-1, height-1
+	header[6], header[7], header[8] = byte(w), byte(w>>8), byte(w>>16)
+	header[9], header[10], header[11] = byte(h), byte(h>>8), byte(h>>16)
+	header[12], header[13], header[14] = byte(durationMs), byte(durationMs>>8), byte(durationMs>>16)
+	header[15] = flags
+
+	var body bytes.Buffer
+	body.Write(header)
+	for _, c := range sub {
+		writeTestChunk(&body, c.fourCC, c.data)
+	}
+	return body.Bytes()
+}
+
+func TestParseANMFBlendDisposeFlags(t *testing.T) {
+	vp8l := encodeVP8LChunk(t)
+
+	tests := []struct {
+		name                    string
+		flags                   byte
+		wantBlend               bool
+		wantDisposeToBackground bool
+	}{
+		{"без флагов: alpha-blend, не восстанавливать фон", 0x00, true, false},
+		{"бит 0 (dispose): alpha-blend, восстановить фон", 0x01, true, true},
+		{"бит 1 (blend): перезаписать, не восстанавливать фон", 0x02, false, false},
+		{"оба бита: перезаписать, восстановить фон", 0x03, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := buildANMFPayload(1, 1, 100, tt.flags, []riffChunk{vp8l})
+			frame, err := parseANMF(payload)
+			if err != nil {
+				t.Fatalf("parseANMF: %v", err)
+			}
+			if frame.blend != tt.wantBlend {
+				t.Errorf("blend = %v, хотели %v", frame.blend, tt.wantBlend)
+			}
+			if frame.disposeToBackground != tt.wantDisposeToBackground {
+				t.Errorf("disposeToBackground = %v, хотели %v", frame.disposeToBackground, tt.wantDisposeToBackground)
+			}
+		})
+	}
+}